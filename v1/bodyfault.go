@@ -0,0 +1,46 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package resilience
+
+import "net/http"
+
+// FaultAction describes what responseWriter.Write does once a BodyFault
+// triggers.
+type FaultAction int
+
+const (
+	// FaultTruncate stops writing the response body after AfterBytes,
+	// without closing the connection; the client observes a short read.
+	FaultTruncate FaultAction = iota + 1
+	// FaultInvalidChunk writes a malformed chunk-size line after
+	// AfterBytes, corrupting the chunked transfer framing, then closes the
+	// connection. The underlying ResponseWriter must implement
+	// http.Hijacker; if it doesn't, FaultInvalidChunk behaves like
+	// FaultTruncate.
+	FaultInvalidChunk
+	// FaultCloseConnection hijacks and abruptly closes the underlying
+	// connection after AfterBytes. The underlying ResponseWriter must
+	// implement http.Hijacker; if it doesn't, FaultCloseConnection behaves
+	// like FaultTruncate.
+	FaultCloseConnection
+	// FaultTrailer stops writing the body after AfterBytes and instead
+	// sends a valid chunked trailer with an X-Error header describing the
+	// failure.
+	FaultTrailer
+)
+
+// BodyFault describes a mid-response body fault to inject.
+type BodyFault struct {
+	// AfterBytes is the number of response body bytes to write normally
+	// before Action triggers.
+	AfterBytes int64
+	// Action is the fault to trigger once AfterBytes have been written.
+	Action FaultAction
+}
+
+// ShouldCorrupt returns the BodyFault to apply to the current request's
+// response body, or nil for none. It is called once per request, before
+// the wrapped Handler starts writing the body.
+type ShouldCorrupt func(r *http.Request) *BodyFault
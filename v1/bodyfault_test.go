@@ -0,0 +1,175 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package resilience_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/maruel/resilience/v1"
+)
+
+func TestServeHTTP_bodyFault_truncate(t *testing.T) {
+	req := httptest.NewRequest("GET", "/foo", nil)
+	h := resilience.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello world")
+		}),
+		ShouldFail: func(r *http.Request, afterHeader bool) int {
+			return 0
+		},
+		ShouldCorrupt: func(r *http.Request) *resilience.BodyFault {
+			return &resilience.BodyFault{AfterBytes: 5, Action: resilience.FaultTruncate}
+		},
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	b, _ := ioutil.ReadAll(w.Result().Body)
+	if expected := "hello"; expected != string(b) {
+		t.Fatalf("%q != %q", string(b), expected)
+	}
+}
+
+func TestServeHTTP_bodyFault_truncate_discardsLaterWrites(t *testing.T) {
+	req := httptest.NewRequest("GET", "/foo", nil)
+	h := resilience.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello")
+			io.WriteString(w, " world")
+			io.WriteString(w, "!!!LEAKED!!!")
+		}),
+		ShouldFail: func(r *http.Request, afterHeader bool) int {
+			return 0
+		},
+		ShouldCorrupt: func(r *http.Request) *resilience.BodyFault {
+			return &resilience.BodyFault{AfterBytes: 5, Action: resilience.FaultTruncate}
+		},
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	b, _ := ioutil.ReadAll(w.Result().Body)
+	if expected := "hello"; expected != string(b) {
+		t.Fatalf("%q != %q", string(b), expected)
+	}
+}
+
+func TestServeHTTP_bodyFault_trailer(t *testing.T) {
+	req := httptest.NewRequest("GET", "/foo", nil)
+	h := resilience.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello world")
+		}),
+		ShouldFail: func(r *http.Request, afterHeader bool) int {
+			return 0
+		},
+		ShouldCorrupt: func(r *http.Request) *resilience.BodyFault {
+			return &resilience.BodyFault{AfterBytes: 5, Action: resilience.FaultTrailer}
+		},
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Header().Get("X-Error") == "" {
+		t.Fatal("expected X-Error to be set")
+	}
+}
+
+func TestServeHTTP_bodyFault_invalidChunk(t *testing.T) {
+	h := resilience.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello world")
+		}),
+		ShouldFail: func(r *http.Request, afterHeader bool) int {
+			return 0
+		},
+		ShouldCorrupt: func(r *http.Request) *resilience.BodyFault {
+			return &resilience.BodyFault{AfterBytes: 5, Action: resilience.FaultInvalidChunk}
+		},
+	}
+	srv := httptest.NewServer(&h)
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if _, err := ioutil.ReadAll(res.Body); err == nil {
+		t.Fatal("expected the corrupted chunk framing to surface a read error")
+	}
+}
+
+func TestServeHTTP_bodyFault_closeConnection(t *testing.T) {
+	h := resilience.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello world")
+		}),
+		ShouldFail: func(r *http.Request, afterHeader bool) int {
+			return 0
+		},
+		ShouldCorrupt: func(r *http.Request) *resilience.BodyFault {
+			return &resilience.BodyFault{AfterBytes: 5, Action: resilience.FaultCloseConnection}
+		},
+	}
+	srv := httptest.NewServer(&h)
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err == nil {
+		t.Fatalf("expected a read error from the abruptly closed connection, got body %q", b)
+	}
+}
+
+func TestServeHTTP_bodyFault_noHijackerFallback(t *testing.T) {
+	// httptest.ResponseRecorder doesn't implement http.Hijacker, so
+	// FaultInvalidChunk and FaultCloseConnection must fall back to behaving
+	// like FaultTruncate instead of panicking or writing past AfterBytes.
+	for _, action := range []resilience.FaultAction{resilience.FaultInvalidChunk, resilience.FaultCloseConnection} {
+		req := httptest.NewRequest("GET", "/foo", nil)
+		h := resilience.Handler{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "hello world")
+			}),
+			ShouldFail: func(r *http.Request, afterHeader bool) int {
+				return 0
+			},
+			ShouldCorrupt: func(r *http.Request) *resilience.BodyFault {
+				return &resilience.BodyFault{AfterBytes: 5, Action: action}
+			},
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		b, _ := ioutil.ReadAll(w.Result().Body)
+		if expected := "hello"; expected != string(b) {
+			t.Fatalf("action %v: %q != %q", action, string(b), expected)
+		}
+	}
+}
+
+func TestServeHTTP_bodyFault_none(t *testing.T) {
+	req := httptest.NewRequest("GET", "/foo", nil)
+	h := resilience.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello world")
+		}),
+		ShouldFail: func(r *http.Request, afterHeader bool) int {
+			return 0
+		},
+		ShouldCorrupt: func(r *http.Request) *resilience.BodyFault {
+			return nil
+		},
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	b, _ := ioutil.ReadAll(w.Result().Body)
+	if expected := "hello world"; expected != string(b) {
+		t.Fatalf("%q != %q", string(b), expected)
+	}
+}
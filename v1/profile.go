@@ -0,0 +1,279 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package resilience
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Profile is a ready-made fault behavior that can be composed with other
+// Profiles via Chain.
+//
+// Each field is optional; a zero Profile never fails, never delays and
+// never throttles a request.
+type Profile struct {
+	// ShouldFail follows the same semantics as the package-level ShouldFail
+	// type and is called both before and after headers are written.
+	ShouldFail ShouldFail
+	// Latency, when non-nil, is called once per request to determine how
+	// long to sleep before forwarding the request to the wrapped handler.
+	Latency func(r *http.Request) time.Duration
+	// Throttle, when non-nil, is called once per request to determine the
+	// rate at which the response body is written, in bytes per second, or 0
+	// for no throttling.
+	Throttle func(r *http.Request) int
+	// Corrupt, when non-nil, is called once per request to decide whether
+	// the response body written by the wrapped handler should be mangled.
+	Corrupt func(r *http.Request) bool
+}
+
+// NewRandomFailure returns a Profile that fails a request early, before any
+// response headers are sent, with one of the provided HTTP status codes,
+// each with equal probability, rate fraction of the time. Use
+// NewLateRandomFailure for a failure injected after the wrapped handler has
+// already started writing its response.
+func NewRandomFailure(rate float64, statuses []int) Profile {
+	return newRandomFailure(rate, statuses, false)
+}
+
+// NewLateRandomFailure is like NewRandomFailure, except the failure is
+// injected after the wrapped handler has already started writing its
+// response, once it is too late to change the response headers.
+func NewLateRandomFailure(rate float64, statuses []int) Profile {
+	return newRandomFailure(rate, statuses, true)
+}
+
+func newRandomFailure(rate float64, statuses []int, afterHeader bool) Profile {
+	if len(statuses) == 0 {
+		panic("resilience: statuses must not be empty")
+	}
+	return Profile{
+		ShouldFail: func(r *http.Request, ah bool) int {
+			if ah != afterHeader || rand.Float64() >= rate {
+				return 0
+			}
+			return statuses[rand.Intn(len(statuses))]
+		},
+	}
+}
+
+// WeightedStatus pairs an HTTP status code with the probability, evaluated
+// independently of the other statuses, that it triggers. Since
+// NewWeightedFailure returns the first status that triggers, a status is
+// returned less often than its Rate when statuses before it can trigger.
+type WeightedStatus struct {
+	Status int
+	Rate   float64
+}
+
+// NewWeightedFailure returns a Profile that fails a request with the first
+// status in statuses whose own Rate triggers, each evaluated independently,
+// either early or late depending on afterHeader. It lets each candidate
+// status have its own probability, e.g. to combine "10% early 500 + 5% late
+// 502" via Chain:
+//
+//	resilience.Chain(
+//		resilience.NewWeightedFailure(false, resilience.WeightedStatus{Status: 500, Rate: 0.1}),
+//		resilience.NewWeightedFailure(true, resilience.WeightedStatus{Status: 502, Rate: 0.05}),
+//	)
+func NewWeightedFailure(afterHeader bool, statuses ...WeightedStatus) Profile {
+	if len(statuses) == 0 {
+		panic("resilience: statuses must not be empty")
+	}
+	return Profile{
+		ShouldFail: func(r *http.Request, ah bool) int {
+			if ah != afterHeader {
+				return 0
+			}
+			for _, s := range statuses {
+				if rand.Float64() < s.Rate {
+					return s.Status
+				}
+			}
+			return 0
+		},
+	}
+}
+
+// NewLatencyInjector returns a Profile that adds a random delay uniformly
+// distributed between min and max, rate fraction of the time.
+func NewLatencyInjector(min, max time.Duration, rate float64) Profile {
+	if max < min {
+		panic("resilience: max must be >= min")
+	}
+	return Profile{
+		Latency: func(r *http.Request) time.Duration {
+			if rand.Float64() >= rate {
+				return 0
+			}
+			if max == min {
+				return min
+			}
+			return min + time.Duration(rand.Int63n(int64(max-min)))
+		},
+	}
+}
+
+// NewSlowLoris returns a Profile that throttles the response body to
+// bytesPerSecond, rate fraction of the time, to simulate a slow, trickling
+// client or an overloaded upstream.
+func NewSlowLoris(bytesPerSecond int, rate float64) Profile {
+	if bytesPerSecond <= 0 {
+		panic("resilience: bytesPerSecond must be > 0")
+	}
+	return Profile{
+		Throttle: func(r *http.Request) int {
+			if rand.Float64() >= rate {
+				return 0
+			}
+			return bytesPerSecond
+		},
+	}
+}
+
+// NewBodyCorruptor returns a Profile that mangles the response body rate
+// fraction of the time, after headers have already been sent. It is useful
+// to exercise client-side checksum or content-length validation.
+func NewBodyCorruptor(rate float64) Profile {
+	return Profile{
+		Corrupt: func(r *http.Request) bool {
+			return rand.Float64() < rate
+		},
+	}
+}
+
+// Chain composes multiple Profiles into a single middleware: the first
+// Profile whose ShouldFail returns non-zero wins, latencies are summed, the
+// last Profile whose Throttle returns non-zero sets the response body rate,
+// and the response body is corrupted once if any Profile's Corrupt returns
+// true.
+//
+// The returned function wraps an http.Handler, so profiles can be composed
+// without hand-rolling PRNG state or time.Sleep calls:
+//
+//	h := resilience.Chain(
+//		resilience.NewRandomFailure(0.1, []int{500}),
+//		resilience.NewLateRandomFailure(0.05, []int{502}),
+//		resilience.NewLatencyInjector(0, 200*time.Millisecond, 1),
+//	)(realHandler)
+func Chain(profiles ...Profile) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return &Handler{
+			Handler: &chainedHandler{next: next, profiles: profiles},
+			ShouldFail: func(r *http.Request, afterHeader bool) int {
+				for _, p := range profiles {
+					if p.ShouldFail == nil {
+						continue
+					}
+					if s := p.ShouldFail(r, afterHeader); s != 0 {
+						return s
+					}
+				}
+				return 0
+			},
+		}
+	}
+}
+
+// chainedHandler applies the latency, throttle and corruption aspects of a
+// set of Profiles before delegating to the real handler. ShouldFail is
+// handled by the enclosing Handler.
+type chainedHandler struct {
+	next     http.Handler
+	profiles []Profile
+}
+
+func (c *chainedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var delay time.Duration
+	throttle := 0
+	corrupt := false
+	for _, p := range c.profiles {
+		if p.Latency != nil {
+			delay += p.Latency(r)
+		}
+		if p.Throttle != nil {
+			if t := p.Throttle(r); t > 0 {
+				throttle = t
+			}
+		}
+		if p.Corrupt != nil && p.Corrupt(r) {
+			corrupt = true
+		}
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if throttle > 0 || corrupt {
+		w = &faultyWriter{ResponseWriter: w, bytesPerSecond: throttle, corrupt: corrupt}
+	}
+	c.next.ServeHTTP(w, r)
+}
+
+// faultyWriter throttles and/or corrupts the bytes written to the
+// underlying http.ResponseWriter.
+type faultyWriter struct {
+	http.ResponseWriter
+	bytesPerSecond int
+	corrupt        bool
+}
+
+func (f *faultyWriter) Write(data []byte) (int, error) {
+	if f.corrupt && len(data) > 0 {
+		data = append([]byte(nil), data...)
+		data[len(data)/2] ^= 0xff
+	}
+	if f.bytesPerSecond <= 0 {
+		return f.ResponseWriter.Write(data)
+	}
+	written := 0
+	for len(data) > 0 {
+		chunk := f.bytesPerSecond
+		if chunk > len(data) {
+			chunk = len(data)
+		}
+		n, err := f.ResponseWriter.Write(data[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		data = data[chunk:]
+		if len(data) > 0 {
+			time.Sleep(time.Second)
+		}
+	}
+	return written, nil
+}
+
+// Hijack delegates to the wrapped ResponseWriter, same as responseWriter,
+// so Chain-ing a Throttle or Corrupt Profile doesn't strip the underlying
+// handler's ability to hijack the connection.
+func (f *faultyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := f.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("resilience: underlying ResponseWriter does not support Hijack")
+	}
+	return h.Hijack()
+}
+
+// Flush delegates to the wrapped ResponseWriter, same as responseWriter.
+func (f *faultyWriter) Flush() {
+	if fl, ok := f.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// Push delegates to the wrapped ResponseWriter, same as responseWriter.
+func (f *faultyWriter) Push(target string, opts *http.PushOptions) error {
+	p, ok := f.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package resilience_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/maruel/resilience/v1"
+)
+
+func TestNewRandomFailure_always(t *testing.T) {
+	p := resilience.NewRandomFailure(1, []int{503})
+	h := resilience.Chain(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Result().StatusCode != 503 {
+		t.Fatal(w.Result().Status)
+	}
+}
+
+func TestNewRandomFailure_never(t *testing.T) {
+	p := resilience.NewRandomFailure(0, []int{503})
+	h := resilience.Chain(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Result().StatusCode != 200 {
+		t.Fatal(w.Result().Status)
+	}
+}
+
+func TestNewLateRandomFailure(t *testing.T) {
+	p := resilience.NewLateRandomFailure(1, []int{502})
+	h := resilience.Chain(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Result().StatusCode != 502 {
+		t.Fatal(w.Result().Status)
+	}
+}
+
+func TestNewLateRandomFailure_never(t *testing.T) {
+	p := resilience.NewLateRandomFailure(0, []int{502})
+	h := resilience.Chain(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Result().StatusCode != 200 {
+		t.Fatal(w.Result().Status)
+	}
+}
+
+func TestNewWeightedFailure(t *testing.T) {
+	p := resilience.NewWeightedFailure(false, resilience.WeightedStatus{Status: 503, Rate: 0}, resilience.WeightedStatus{Status: 504, Rate: 1})
+	h := resilience.Chain(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Result().StatusCode != 504 {
+		t.Fatalf("expected the 100%% weighted status to win, got %s", w.Result().Status)
+	}
+}
+
+func TestNewWeightedFailure_afterHeader(t *testing.T) {
+	p := resilience.NewWeightedFailure(true, resilience.WeightedStatus{Status: 429, Rate: 1})
+	h := resilience.Chain(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Result().StatusCode != 429 {
+		t.Fatal(w.Result().Status)
+	}
+}
+
+func TestNewLatencyInjector(t *testing.T) {
+	p := resilience.NewLatencyInjector(10*time.Millisecond, 10*time.Millisecond, 1)
+	h := resilience.Chain(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	start := time.Now()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Fatalf("expected at least 10ms of latency, got %s", elapsed)
+	}
+}
+
+func TestNewSlowLoris(t *testing.T) {
+	p := resilience.NewSlowLoris(1, 1)
+	h := resilience.Chain(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ab")
+	}))
+	w := httptest.NewRecorder()
+	start := time.Now()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected the 1 byte/s throttle to delay a 2 byte body by at least 1s, got %s", elapsed)
+	}
+	b, _ := ioutil.ReadAll(w.Result().Body)
+	if expected := "ab"; expected != string(b) {
+		t.Fatalf("%q != %q", string(b), expected)
+	}
+}
+
+func TestNewBodyCorruptor(t *testing.T) {
+	p := resilience.NewBodyCorruptor(1)
+	h := resilience.Chain(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	b, _ := ioutil.ReadAll(w.Result().Body)
+	if string(b) == "hello" {
+		t.Fatal("expected the body to be corrupted")
+	}
+}
+
+func TestChain_multiple(t *testing.T) {
+	h := resilience.Chain(
+		resilience.NewRandomFailure(0, []int{500}),
+		resilience.NewRandomFailure(1, []int{503}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Result().StatusCode != 503 {
+		t.Fatal(w.Result().Status)
+	}
+}
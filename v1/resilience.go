@@ -7,7 +7,10 @@
 package resilience
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 )
 
@@ -26,6 +29,10 @@ type ShouldFail func(r *http.Request, afterHeader bool) int
 type Handler struct {
 	Handler    http.Handler
 	ShouldFail ShouldFail
+	// ShouldCorrupt is optional. When set, it is called once per request to
+	// decide whether to inject a mid-body fault into the response written
+	// by Handler. See BodyFault for the available fault actions.
+	ShouldCorrupt ShouldCorrupt
 }
 
 // ServeHTTP implements http.Handler.
@@ -38,7 +45,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(s)
 		return
 	}
-	h.Handler.ServeHTTP(&responseWriter{w, r, h.ShouldFail, 0}, r)
+	var fault *BodyFault
+	if h.ShouldCorrupt != nil {
+		fault = h.ShouldCorrupt(r)
+	}
+	h.Handler.ServeHTTP(&responseWriter{ResponseWriter: w, req: r, shouldFail: h.ShouldFail, fault: fault}, r)
 }
 
 type responseWriter struct {
@@ -46,13 +57,25 @@ type responseWriter struct {
 	req        *http.Request
 	shouldFail ShouldFail
 	status     int
+	fault      *BodyFault
+	written    int64
+	triggered  bool
 }
 
 func (r *responseWriter) Write(data []byte) (size int, err error) {
 	if r.status == 0 {
 		r.WriteHeader(http.StatusOK)
 	}
-	return r.ResponseWriter.Write(data)
+	if r.triggered {
+		// The fault already fired; keep discarding so a handler that
+		// doesn't abort on the first Write error can't leak bytes past the
+		// injected fault.
+		return 0, io.ErrClosedPipe
+	}
+	if r.fault == nil {
+		return r.ResponseWriter.Write(data)
+	}
+	return r.writeWithFault(data)
 }
 
 func (r *responseWriter) WriteHeader(status int) {
@@ -66,6 +89,107 @@ func (r *responseWriter) WriteHeader(status int) {
 		}
 		status = s
 	}
+	if r.fault != nil && r.fault.Action == FaultTrailer {
+		r.Header().Set("Trailer", "X-Error")
+	}
 	r.ResponseWriter.WriteHeader(status)
 	r.status = status
 }
+
+// writeWithFault writes up to fault.AfterBytes of data normally, then
+// triggers fault.Action instead of writing the rest.
+func (r *responseWriter) writeWithFault(data []byte) (int, error) {
+	remaining := r.fault.AfterBytes - r.written
+	if remaining >= int64(len(data)) {
+		n, err := r.ResponseWriter.Write(data)
+		r.written += int64(n)
+		return n, err
+	}
+	var n int
+	var err error
+	if remaining > 0 {
+		if n, err = r.ResponseWriter.Write(data[:remaining]); err != nil {
+			r.written += int64(n)
+			return n, err
+		}
+		r.written += int64(n)
+	}
+	r.triggered = true
+	return n, r.triggerFault()
+}
+
+// triggerFault applies r.fault.Action and returns the error to report to
+// the handler that was writing the response body.
+func (r *responseWriter) triggerFault() error {
+	switch r.fault.Action {
+	case FaultInvalidChunk, FaultCloseConnection:
+		hj, ok := r.ResponseWriter.(http.Hijacker)
+		if !ok {
+			return io.ErrClosedPipe
+		}
+		// Push the AfterBytes already written out to the client before
+		// taking over the connection; Hijack drops buffered body bytes.
+		if f, ok := r.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+		conn, buf, err := hj.Hijack()
+		if err != nil {
+			return io.ErrClosedPipe
+		}
+		if r.fault.Action == FaultInvalidChunk {
+			// Not a valid hex chunk-size line; the client must treat the
+			// remainder of the stream as corrupt.
+			buf.WriteString("not-a-chunk-size\r\n")
+			buf.Flush()
+		}
+		conn.Close()
+		return io.ErrClosedPipe
+	case FaultTrailer:
+		r.Header().Set("X-Error", "resilience: injected body fault")
+		return io.ErrClosedPipe
+	default:
+		// FaultTruncate: simply stop writing.
+		return io.ErrClosedPipe
+	}
+}
+
+// Hijack implements http.Hijacker by delegating to the wrapped
+// ResponseWriter, so WebSocket upgrades keep working through the handler.
+func (r *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("resilience: underlying ResponseWriter does not support Hijack")
+	}
+	return h.Hijack()
+}
+
+// Flush implements http.Flusher by delegating to the wrapped
+// ResponseWriter, so streaming responses (e.g. SSE) keep working through
+// the handler. It is a no-op if the wrapped ResponseWriter doesn't support
+// flushing.
+func (r *responseWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Push implements http.Pusher by delegating to the wrapped ResponseWriter,
+// so HTTP/2 server push keeps working through the handler.
+func (r *responseWriter) Push(target string, opts *http.PushOptions) error {
+	p, ok := r.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+// CloseNotify implements http.CloseNotifier by delegating to the wrapped
+// ResponseWriter. It is deprecated upstream but still relied upon by some
+// handlers, so it is passed through for compatibility.
+func (r *responseWriter) CloseNotify() <-chan bool {
+	if cn, ok := r.ResponseWriter.(http.CloseNotifier); ok { //lint:ignore SA1019 passthrough only
+		return cn.CloseNotify()
+	}
+	c := make(chan bool)
+	return c
+}
@@ -160,3 +160,53 @@ func (d *dummy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	d.called = true
 	io.WriteString(w, "hello")
 }
+
+func TestServeHTTP_hijack(t *testing.T) {
+	h := resilience.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			io.WriteString(buf, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello")
+			buf.Flush()
+		}),
+		ShouldFail: func(r *http.Request, afterHeader bool) int {
+			return 0
+		},
+	}
+	srv := httptest.NewServer(&h)
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "hello"; expected != string(b) {
+		t.Fatalf("%q != %q", string(b), expected)
+	}
+}
+
+func TestServeHTTP_flush(t *testing.T) {
+	req := httptest.NewRequest("GET", "/foo", &bytes.Buffer{})
+	h := resilience.Handler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello")
+			w.(http.Flusher).Flush()
+		}),
+		ShouldFail: func(r *http.Request, afterHeader bool) int {
+			return 0
+		},
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if !w.Flushed {
+		t.Fatal("expected Flush to propagate to the underlying ResponseWriter")
+	}
+}
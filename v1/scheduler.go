@@ -0,0 +1,166 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package resilience
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Scheduler decides whether the current request should fail, independently
+// of which status code is returned or how the failure is presented. This
+// separates "should this request fail" from the effect, so the same
+// Scheduler can drive ShouldFail, BodyFault injection, or anything else.
+type Scheduler interface {
+	// ShouldSchedule returns true when the current request should fail.
+	ShouldSchedule(r *http.Request) bool
+}
+
+// SchedulerFunc adapts a plain function to a Scheduler.
+type SchedulerFunc func(r *http.Request) bool
+
+// ShouldSchedule implements Scheduler.
+func (f SchedulerFunc) ShouldSchedule(r *http.Request) bool {
+	return f(r)
+}
+
+// StatusPicker is implemented by Schedulers that can also deterministically
+// pick which of several candidate statuses a scheduled failure should use,
+// so Schedule doesn't have to fall back to the unseeded global math/rand
+// source and break reproducibility.
+type StatusPicker interface {
+	PickStatus(r *http.Request, statuses []int) int
+}
+
+// randomScheduler is a Scheduler and StatusPicker backed by the same seeded
+// PRNG, so both whether a request fails and which status it fails with are
+// reproducible across runs.
+type randomScheduler struct {
+	mu   sync.Mutex
+	rnd  *rand.Rand
+	rate float64
+}
+
+// RandomScheduler returns a Scheduler backed by a seeded PRNG, so that the
+// sequence of failures is reproducible across runs of the same test, unlike
+// a ShouldFail closure calling the global math/rand source directly.
+func RandomScheduler(seed int64, rate float64) Scheduler {
+	return &randomScheduler{rnd: rand.New(rand.NewSource(seed)), rate: rate}
+}
+
+// ShouldSchedule implements Scheduler.
+func (s *randomScheduler) ShouldSchedule(r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rnd.Float64() < s.rate
+}
+
+// PickStatus implements StatusPicker, drawing from the same seeded PRNG as
+// ShouldSchedule so the chosen status is as reproducible as the scheduling
+// decision itself.
+func (s *randomScheduler) PickStatus(r *http.Request, statuses []int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return statuses[s.rnd.Intn(len(statuses))]
+}
+
+// PatternScheduler returns a Scheduler that cycles through pattern, one
+// entry per request, repeating once exhausted. It is useful to reproduce an
+// exact sequence of successes and failures deterministically.
+func PatternScheduler(pattern []bool) Scheduler {
+	if len(pattern) == 0 {
+		panic("resilience: pattern must not be empty")
+	}
+	var mu sync.Mutex
+	i := 0
+	return SchedulerFunc(func(r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		v := pattern[i%len(pattern)]
+		i++
+		return v
+	})
+}
+
+// RateLimitedScheduler returns a Scheduler that schedules failures at most
+// perSecond times per second, using a token bucket that holds at most one
+// token and starts full, so the first call always schedules a failure.
+func RateLimitedScheduler(perSecond float64) Scheduler {
+	var mu sync.Mutex
+	tokens := 1.0
+	last := time.Time{}
+	return SchedulerFunc(func(r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		if !last.IsZero() {
+			if tokens += now.Sub(last).Seconds() * perSecond; tokens > 1 {
+				tokens = 1
+			}
+		}
+		last = now
+		if tokens < 1 {
+			return false
+		}
+		tokens--
+		return true
+	})
+}
+
+// HeaderTriggeredScheduler returns a Scheduler that schedules a failure
+// whenever the request carries a non-empty headerName header, letting
+// integration tests deterministically request a fault, e.g. with
+// X-Chaos: 503.
+func HeaderTriggeredScheduler(headerName string) Scheduler {
+	return SchedulerFunc(func(r *http.Request) bool {
+		return r.Header.Get(headerName) != ""
+	})
+}
+
+type faultContextKey struct{}
+
+// Schedule returns middleware that uses s to decide, once per request,
+// whether to fail it with one of statuses, and records that decision on the
+// request's context so downstream middleware or logging can retrieve it
+// with FaultFromContext.
+func Schedule(s Scheduler, statuses []int) func(http.Handler) http.Handler {
+	if len(statuses) == 0 {
+		panic("resilience: statuses must not be empty")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			status := 0
+			if s.ShouldSchedule(r) {
+				if p, ok := s.(StatusPicker); ok {
+					status = p.PickStatus(r, statuses)
+				} else {
+					status = statuses[rand.Intn(len(statuses))]
+				}
+				r = r.WithContext(context.WithValue(r.Context(), faultContextKey{}, status))
+			}
+			h := Handler{
+				Handler: next,
+				ShouldFail: func(r *http.Request, afterHeader bool) int {
+					if !afterHeader {
+						return 0
+					}
+					return status
+				},
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// FaultFromContext returns the HTTP status code the current request was
+// scheduled to fail with by Schedule, and whether a fault was scheduled at
+// all.
+func FaultFromContext(ctx context.Context) (int, bool) {
+	status, ok := ctx.Value(faultContextKey{}).(int)
+	return status, ok
+}
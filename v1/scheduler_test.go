@@ -0,0 +1,105 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package resilience_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/maruel/resilience/v1"
+)
+
+func TestRandomScheduler_reproducible(t *testing.T) {
+	run := func(seed int64) []int {
+		s := resilience.RandomScheduler(seed, 0.5)
+		h := resilience.Schedule(s, []int{500, 502, 503, 504})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello")
+		}))
+		var got []int
+		for i := 0; i < 20; i++ {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+			got = append(got, w.Result().StatusCode)
+		}
+		return got
+	}
+	a := run(42)
+	b := run(42)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("request %d: got %d and %d from the same seed, want the same status in both runs", i, a[i], b[i])
+		}
+	}
+}
+
+func TestPatternScheduler(t *testing.T) {
+	s := resilience.PatternScheduler([]bool{false, true})
+	h := resilience.Schedule(s, []int{503})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	for i, want := range []int{200, 503, 200, 503} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+		if got := w.Result().StatusCode; got != want {
+			t.Fatalf("request %d: got %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestHeaderTriggeredScheduler(t *testing.T) {
+	s := resilience.HeaderTriggeredScheduler("X-Chaos")
+	h := resilience.Schedule(s, []int{503})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+
+	req := httptest.NewRequest("GET", "/foo", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Result().StatusCode != 200 {
+		t.Fatalf("expected no fault, got %s", w.Result().Status)
+	}
+
+	req = httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set("X-Chaos", "1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Result().StatusCode != 503 {
+		t.Fatalf("expected fault, got %s", w.Result().Status)
+	}
+}
+
+func TestRateLimitedScheduler(t *testing.T) {
+	s := resilience.RateLimitedScheduler(1)
+	req := httptest.NewRequest("GET", "/foo", nil)
+	if !s.ShouldSchedule(req) {
+		t.Fatal("expected the first call to consume the initial token and schedule a failure")
+	}
+	if s.ShouldSchedule(req) {
+		t.Fatal("expected the immediately following call to be rate limited")
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if !s.ShouldSchedule(req) {
+		t.Fatal("expected a token to have replenished after waiting over 1s")
+	}
+}
+
+func TestFaultFromContext(t *testing.T) {
+	var gotStatus int
+	var gotOK bool
+	s := resilience.HeaderTriggeredScheduler("X-Chaos")
+	h := resilience.Schedule(s, []int{503})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotStatus, gotOK = resilience.FaultFromContext(r.Context())
+		io.WriteString(w, "hello")
+	}))
+	req := httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set("X-Chaos", "1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !gotOK || gotStatus != 503 {
+		t.Fatalf("got (%d, %v), want (503, true)", gotStatus, gotOK)
+	}
+}
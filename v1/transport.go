@@ -0,0 +1,92 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package resilience
+
+import (
+	"io"
+	"net/http"
+)
+
+// Phase identifies the point in an outgoing request's lifecycle at which a
+// Transport can inject a fault.
+type Phase int
+
+const (
+	// DialPhase is evaluated before the request is handed to the wrapped
+	// RoundTripper, standing in for DNS failures, connection refused and
+	// TLS handshake errors.
+	DialPhase Phase = iota + 1
+	// RequestWritePhase is evaluated while the request body is being read
+	// by the wrapped RoundTripper, simulating a stalled or reset upload.
+	RequestWritePhase
+	// ResponseHeaderPhase is evaluated right after the wrapped RoundTripper
+	// returns, before the response is handed back to the caller.
+	ResponseHeaderPhase
+	// ResponseBodyPhase is evaluated while the response body is being read
+	// by the caller, simulating a reset or truncated download.
+	ResponseBodyPhase
+)
+
+// TransportShouldFail returns a non-nil error when the request should fail
+// at the given phase. It is called once for DialPhase and
+// ResponseHeaderPhase, and once per Read call for RequestWritePhase and
+// ResponseBodyPhase.
+type TransportShouldFail func(r *http.Request, phase Phase) error
+
+// Transport wraps an http.RoundTripper to inject faults into outgoing
+// requests, mirroring Handler on the client side. It lets callers exercise
+// their retry and backoff logic against a server they don't control.
+type Transport struct {
+	// RoundTripper is the wrapped transport. http.DefaultTransport is used
+	// if it is nil.
+	RoundTripper http.RoundTripper
+	ShouldFail   TransportShouldFail
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.ShouldFail(r, DialPhase); err != nil {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, err
+	}
+	if r.Body != nil {
+		req := new(http.Request)
+		*req = *r
+		req.Body = &faultReadCloser{ReadCloser: r.Body, req: r, phase: RequestWritePhase, shouldFail: t.ShouldFail}
+		r = req
+	}
+	rt := t.RoundTripper
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	res, err := rt.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.ShouldFail(r, ResponseHeaderPhase); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	res.Body = &faultReadCloser{ReadCloser: res.Body, req: r, phase: ResponseBodyPhase, shouldFail: t.ShouldFail}
+	return res, nil
+}
+
+// faultReadCloser calls shouldFail before every Read, failing the read
+// with whatever error it returns.
+type faultReadCloser struct {
+	io.ReadCloser
+	req        *http.Request
+	phase      Phase
+	shouldFail TransportShouldFail
+}
+
+func (f *faultReadCloser) Read(p []byte) (int, error) {
+	if err := f.shouldFail(f.req, f.phase); err != nil {
+		return 0, err
+	}
+	return f.ReadCloser.Read(p)
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package resilience_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maruel/resilience/v1"
+)
+
+func TestTransport_dialFailure(t *testing.T) {
+	errBoom := errors.New("boom")
+	tr := resilience.Transport{
+		ShouldFail: func(r *http.Request, phase resilience.Phase) error {
+			if phase == resilience.DialPhase {
+				return errBoom
+			}
+			return nil
+		},
+	}
+	req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+	if _, err := tr.RoundTrip(req); err != errBoom {
+		t.Fatalf("got %v, want %v", err, errBoom)
+	}
+}
+
+func TestTransport_dialFailure_closesRequestBody(t *testing.T) {
+	errBoom := errors.New("boom")
+	tr := resilience.Transport{
+		ShouldFail: func(r *http.Request, phase resilience.Phase) error {
+			if phase == resilience.DialPhase {
+				return errBoom
+			}
+			return nil
+		},
+	}
+	body := &trackingBody{Reader: strings.NewReader("payload")}
+	req := httptest.NewRequest("POST", "http://example.com/foo", body)
+	req.Body = body
+	if _, err := tr.RoundTrip(req); err != errBoom {
+		t.Fatalf("got %v, want %v", err, errBoom)
+	}
+	if !body.closed {
+		t.Fatal("expected the request body to be closed before returning the DialPhase error")
+	}
+}
+
+// readingRoundTripper drains the request body, so a RequestWritePhase fault
+// injected into it surfaces as a RoundTrip error, the same way a real
+// transport writing the body to the wire would fail.
+type readingRoundTripper struct{}
+
+func (readingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if _, err := ioutil.ReadAll(r.Body); err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("")), Header: make(http.Header)}, nil
+}
+
+func TestTransport_requestWriteFailure(t *testing.T) {
+	errBoom := errors.New("boom")
+	tr := resilience.Transport{
+		RoundTripper: readingRoundTripper{},
+		ShouldFail: func(r *http.Request, phase resilience.Phase) error {
+			if phase == resilience.RequestWritePhase {
+				return errBoom
+			}
+			return nil
+		},
+	}
+	req := httptest.NewRequest("POST", "http://example.com/foo", strings.NewReader("payload"))
+	if _, err := tr.RoundTrip(req); err != errBoom {
+		t.Fatalf("got %v, want %v", err, errBoom)
+	}
+}
+
+// trackingBody records whether Close was called, to verify the Transport
+// closes the response body before returning a ResponseHeaderPhase error.
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (t *trackingBody) Close() error {
+	t.closed = true
+	return nil
+}
+
+type fakeRoundTripper struct {
+	body *trackingBody
+}
+
+func (f *fakeRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: 200, Body: f.body, Header: make(http.Header)}, nil
+}
+
+func TestTransport_responseHeaderFailure(t *testing.T) {
+	errBoom := errors.New("boom")
+	body := &trackingBody{Reader: strings.NewReader("hello")}
+	tr := resilience.Transport{
+		RoundTripper: &fakeRoundTripper{body: body},
+		ShouldFail: func(r *http.Request, phase resilience.Phase) error {
+			if phase == resilience.ResponseHeaderPhase {
+				return errBoom
+			}
+			return nil
+		},
+	}
+	req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+	if _, err := tr.RoundTrip(req); err != errBoom {
+		t.Fatalf("got %v, want %v", err, errBoom)
+	}
+	if !body.closed {
+		t.Fatal("expected the response body to be closed before returning the error")
+	}
+}
+
+func TestTransport_responseBodyFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+	errBoom := errors.New("boom")
+	tr := resilience.Transport{
+		ShouldFail: func(r *http.Request, phase resilience.Phase) error {
+			if phase == resilience.ResponseBodyPhase {
+				return errBoom
+			}
+			return nil
+		},
+	}
+	req := httptest.NewRequest("GET", srv.URL, nil)
+	req.RequestURI = ""
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if _, err := ioutil.ReadAll(res.Body); err != errBoom {
+		t.Fatalf("got %v, want %v", err, errBoom)
+	}
+}